@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Well-known values of SnapdError.Kind, taken from snapd's
+// errorKind list for the interfaces-requests/apparmor-prompting bits
+// PermissionServer talks to.
+const (
+	KindInterfacesRequestsNotEnabled = "interfaces-requests-not-enabled"
+	KindAuthCancelled                = "auth-cancelled"
+	KindInvalidPathPattern           = "invalid-path-pattern"
+)
+
+// SnapdError is a decoded snapd error response: the machine-readable
+// Kind and human Message from its error envelope, the HTTP status it
+// came with, and any extra structured Value it attached. It implements
+// GRPCStatus so callers can also treat it as a *status.Status without
+// losing the original Kind.
+type SnapdError struct {
+	Kind       string
+	Message    string
+	StatusCode int
+	Value      json.RawMessage
+}
+
+func (e *SnapdError) Error() string {
+	if e.Kind == "" {
+		return fmt.Sprintf("snapd: %s", e.Message)
+	}
+	return fmt.Sprintf("snapd: %s (%s)", e.Message, e.Kind)
+}
+
+// GRPCStatus lets status.FromError/status.Code see this as a proper gRPC
+// status while errors.As still recovers the original *SnapdError.
+func (e *SnapdError) GRPCStatus() *status.Status {
+	return status.New(codeForKind(e.Kind), e.Message)
+}
+
+func codeForKind(kind string) codes.Code {
+	switch kind {
+	case KindInterfacesRequestsNotEnabled:
+		return codes.FailedPrecondition
+	case KindAuthCancelled:
+		return codes.PermissionDenied
+	case KindInvalidPathPattern:
+		return codes.InvalidArgument
+	default:
+		return codes.Unknown
+	}
+}
+
+// snapdErrorFromResult decodes the "result" object of a snapd error
+// envelope ({"type":"error","status-code":N,"result":{...}}) into a
+// SnapdError.
+func snapdErrorFromResult(statusCode int, result json.RawMessage) *SnapdError {
+	var body struct {
+		Message string          `json:"message"`
+		Kind    string          `json:"kind"`
+		Value   json.RawMessage `json:"value"`
+	}
+	// Malformed error bodies still produce a usable SnapdError with an
+	// empty Kind/Message rather than losing the failure entirely.
+	_ = json.Unmarshal(result, &body)
+	return &SnapdError{
+		Kind:       body.Kind,
+		Message:    body.Message,
+		StatusCode: statusCode,
+		Value:      body.Value,
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSnapdErrorFromResult(t *testing.T) {
+	err := snapdErrorFromResult(400, []byte(`{"message":"apparmor prompting is not enabled","kind":"interfaces-requests-not-enabled"}`))
+	require.Equal(t, "interfaces-requests-not-enabled", err.Kind)
+	require.Equal(t, "apparmor prompting is not enabled", err.Message)
+	require.Equal(t, 400, err.StatusCode)
+}
+
+func TestSnapdErrorGRPCStatus(t *testing.T) {
+	tt := []struct {
+		kind string
+		code codes.Code
+	}{
+		{KindInterfacesRequestsNotEnabled, codes.FailedPrecondition},
+		{KindAuthCancelled, codes.PermissionDenied},
+		{KindInvalidPathPattern, codes.InvalidArgument},
+		{"something-unexpected", codes.Unknown},
+	}
+	for _, tc := range tt {
+		err := &SnapdError{Kind: tc.kind, Message: "boom"}
+		st, ok := status.FromError(err)
+		require.True(t, ok)
+		require.Equal(t, tc.code, st.Code())
+	}
+}
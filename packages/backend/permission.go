@@ -0,0 +1,80 @@
+package main
+
+import "strings"
+
+// Permission is a bitmask of the primitive accesses an apparmor-prompting
+// rule can grant. It replaces the ad-hoc []string{"read","write"} slices
+// snapd's JSON uses on the wire, so combining, narrowing, and comparing
+// grants doesn't need slice surgery.
+type Permission uint8
+
+const (
+	PermRead Permission = 1 << iota
+	PermWrite
+	PermExecute
+)
+
+func (p Permission) IsRead() bool {
+	return p&PermRead != 0
+}
+
+func (p Permission) IsWrite() bool {
+	return p&PermWrite != 0
+}
+
+func (p Permission) IsExecute() bool {
+	return p&PermExecute != 0
+}
+
+// IsReadWrite reports whether p grants both read and write.
+func (p Permission) IsReadWrite() bool {
+	return p&(PermRead|PermWrite) == PermRead|PermWrite
+}
+
+// Union returns the permissions granted by either p or other.
+func (p Permission) Union(other Permission) Permission {
+	return p | other
+}
+
+// Subtract returns p with every permission in other revoked.
+func (p Permission) Subtract(other Permission) Permission {
+	return p &^ other
+}
+
+// String renders p the way snapd's JSON does, e.g. "read,write".
+func (p Permission) String() string {
+	return strings.Join(p.Strings(), ",")
+}
+
+// Strings renders p as the permission-name slice snapd's REST API
+// expects in a rule's constraints.
+func (p Permission) Strings() []string {
+	var out []string
+	if p.IsRead() {
+		out = append(out, "read")
+	}
+	if p.IsWrite() {
+		out = append(out, "write")
+	}
+	if p.IsExecute() {
+		out = append(out, "execute")
+	}
+	return out
+}
+
+// permissionFromStrings converts the permission-name slice snapd's JSON
+// uses into the equivalent bitmask. Unrecognized names are ignored.
+func permissionFromStrings(names []string) Permission {
+	var p Permission
+	for _, name := range names {
+		switch name {
+		case "read":
+			p |= PermRead
+		case "write":
+			p |= PermWrite
+		case "execute":
+			p |= PermExecute
+		}
+	}
+	return p
+}
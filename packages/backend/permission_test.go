@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPermissionFlags(t *testing.T) {
+	rw := PermRead | PermWrite
+	require.True(t, rw.IsRead())
+	require.True(t, rw.IsWrite())
+	require.False(t, rw.IsExecute())
+	require.True(t, rw.IsReadWrite())
+	require.False(t, PermRead.IsReadWrite())
+	require.Equal(t, "read,write", rw.String())
+}
+
+func TestPermissionUnionAndSubtract(t *testing.T) {
+	rw := PermRead.Union(PermWrite)
+	require.Equal(t, PermRead|PermWrite, rw)
+	require.Equal(t, PermRead, rw.Subtract(PermWrite))
+}
+
+func TestPermissionFromStrings(t *testing.T) {
+	require.Equal(t, PermRead|PermWrite, permissionFromStrings([]string{"read", "write"}))
+	require.Equal(t, Permission(0), permissionFromStrings(nil))
+	require.Equal(t, []string{"read", "write"}, (PermRead | PermWrite).Strings())
+}
@@ -0,0 +1,558 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// snapdBaseURL is the virtual host used for every snapd REST request. The
+// actual transport (see SnapdTransport) is what decides whether this
+// ends up dialing /run/snapd.socket, a TCP address, or a test double, so
+// the host part here is never resolved.
+const snapdBaseURL = "http://localhost"
+
+// ctx is a package-level background context for code that has no
+// request-scoped one of its own; in this package only the tests use it.
+// gRPC handlers, including SubscribePrompts' polling loop, use the
+// context they are handed.
+var ctx = context.Background()
+
+// PermissionServer implements the Permission gRPC service on top of
+// snapd's apparmor-prompting REST API.
+type PermissionServer struct {
+	transport SnapdTransport
+}
+
+// NewPermissionServer builds a PermissionServer that talks to snapd
+// through transport.
+func NewPermissionServer(transport SnapdTransport) *PermissionServer {
+	return &PermissionServer{transport: transport}
+}
+
+// snapdEnvelope mirrors the outer JSON object every snapd REST response
+// is wrapped in, success or failure.
+type snapdEnvelope struct {
+	Type       string          `json:"type"`
+	StatusCode int             `json:"status-code"`
+	Result     json.RawMessage `json:"result"`
+}
+
+// do issues a snapd REST request and returns the raw "result" payload on
+// success. A snapd-level failure (envelope.Type == "error") comes back
+// as a *SnapdError rather than the usual opaque error, so callers and
+// their gRPC clients can tell failure modes apart.
+func (s *PermissionServer) do(ctx context.Context, method, path string, body []byte) (json.RawMessage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var reqBody *bytes.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	} else {
+		reqBody = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, snapdBaseURL+path, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.transport.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var envelope snapdEnvelope
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return nil, err
+	}
+	if envelope.Type == "error" {
+		return nil, snapdErrorFromResult(envelope.StatusCode, envelope.Result)
+	}
+	return envelope.Result, nil
+}
+
+func (s *PermissionServer) toggleAppPermissions(ctx context.Context, enable bool) (*emptypb.Empty, error) {
+	body, err := json.Marshal(map[string]bool{"experimental.apparmor-prompting": enable})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.do(ctx, http.MethodPut, "/v2/system-conf", body); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// EnableAppPermissions turns snapd's apparmor-prompting experimental
+// feature on.
+func (s *PermissionServer) EnableAppPermissions(ctx context.Context, _ *emptypb.Empty) (*emptypb.Empty, error) {
+	return s.toggleAppPermissions(ctx, true)
+}
+
+// DisableAppPermissions turns snapd's apparmor-prompting experimental
+// feature off.
+func (s *PermissionServer) DisableAppPermissions(ctx context.Context, _ *emptypb.Empty) (*emptypb.Empty, error) {
+	return s.toggleAppPermissions(ctx, false)
+}
+
+// IsAppPermissionsEnabled reports whether apparmor-prompting is currently
+// enabled in snapd.
+func (s *PermissionServer) IsAppPermissionsEnabled(ctx context.Context, _ *emptypb.Empty) (*wrapperspb.BoolValue, error) {
+	result, err := s.do(ctx, http.MethodGet, "/v2/system-info", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed struct {
+		Experimental struct {
+			ApparmorPrompting bool `json:"apparmor-prompting"`
+		} `json:"experimental"`
+	}
+	if err := json.Unmarshal(result, &parsed); err != nil {
+		return nil, err
+	}
+	return wrapperspb.Bool(parsed.Experimental.ApparmorPrompting), nil
+}
+
+// snapdConstraints mirrors the "constraints" object snapd attaches to a
+// prompting rule.
+type snapdConstraints struct {
+	PathPattern string   `json:"path-pattern"`
+	Permissions []string `json:"permissions"`
+}
+
+// snapdRule mirrors a single entry returned by
+// /v2/interfaces/requests/rules.
+type snapdRule struct {
+	ID          string           `json:"id"`
+	Timestamp   string           `json:"timestamp"`
+	User        int64            `json:"user"`
+	Snap        string           `json:"snap"`
+	Interface   string           `json:"interface"`
+	Constraints snapdConstraints `json:"constraints"`
+	Outcome     string           `json:"outcome"`
+	Lifespan    string           `json:"lifespan"`
+	Expiration  string           `json:"expiration"`
+}
+
+func (s *PermissionServer) listCustomRules(ctx context.Context) ([]snapdRule, error) {
+	result, err := s.do(ctx, http.MethodGet, "/v2/interfaces/requests/rules", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []snapdRule
+	if err := json.Unmarshal(result, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// AreCustomRulesApplied reports whether the user has any custom
+// apparmor-prompting rules configured.
+func (s *PermissionServer) AreCustomRulesApplied(ctx context.Context, _ *emptypb.Empty) (*wrapperspb.BoolValue, error) {
+	rules, err := s.listCustomRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return wrapperspb.Bool(len(rules) > 0), nil
+}
+
+// Pathsnap describes one personal-folder access grant: the path pattern
+// it covers and the permissions allowed on it.
+type Pathsnap struct {
+	Path        string
+	Permissions Permission
+}
+
+func (p *Pathsnap) GetPath() string {
+	if p == nil {
+		return ""
+	}
+	return p.Path
+}
+
+func (p *Pathsnap) GetPermissions() Permission {
+	if p == nil {
+		return 0
+	}
+	return p.Permissions
+}
+
+// GetPermissionsString returns the stable string form of Permissions,
+// e.g. "read,write", for callers that just want to display it.
+func (p *Pathsnap) GetPermissionsString() string {
+	return p.GetPermissions().String()
+}
+
+// ListPersonalFoldersPermissionsResponse is the response message for
+// ListPersonalFoldersPermissions.
+type ListPersonalFoldersPermissionsResponse struct {
+	Pathsnaps []*Pathsnap
+}
+
+func (r *ListPersonalFoldersPermissionsResponse) GetPathsnaps() []*Pathsnap {
+	if r == nil {
+		return nil
+	}
+	return r.Pathsnaps
+}
+
+// ListPersonalFoldersPermissions lists the path pattern and permissions
+// of every custom rule snapd reports. Rules are not filtered by
+// interface or by path, so rules outside the user's home directory are
+// listed too.
+func (s *PermissionServer) ListPersonalFoldersPermissions(ctx context.Context, _ *emptypb.Empty) (*ListPersonalFoldersPermissionsResponse, error) {
+	rules, err := s.listCustomRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	snaps := make([]*Pathsnap, 0, len(rules))
+	for _, rule := range rules {
+		snaps = append(snaps, &Pathsnap{
+			Path:        rule.Constraints.PathPattern,
+			Permissions: permissionFromStrings(rule.Constraints.Permissions),
+		})
+	}
+	return &ListPersonalFoldersPermissionsResponse{Pathsnaps: snaps}, nil
+}
+
+// RemoveAppPermissionRequest identifies a single rule to tear down.
+type RemoveAppPermissionRequest struct {
+	Id string
+}
+
+func (r *RemoveAppPermissionRequest) GetId() string {
+	if r == nil {
+		return ""
+	}
+	return r.Id
+}
+
+// RemoveAppPermission revokes a single custom rule by id.
+func (s *PermissionServer) RemoveAppPermission(ctx context.Context, req *RemoveAppPermissionRequest) (*emptypb.Empty, error) {
+	return s.RemoveCustomRule(ctx, &RuleIdRequest{Id: req.GetId()})
+}
+
+// AddCustomRuleRequest is the payload for creating a new prompting rule.
+type AddCustomRuleRequest struct {
+	Snap        string
+	Interface   string
+	PathPattern string
+	Permissions Permission
+	Outcome     string
+	Lifespan    string
+	Duration    string
+}
+
+func (r *AddCustomRuleRequest) GetSnap() string {
+	if r == nil {
+		return ""
+	}
+	return r.Snap
+}
+
+func (r *AddCustomRuleRequest) GetInterface() string {
+	if r == nil {
+		return ""
+	}
+	return r.Interface
+}
+
+func (r *AddCustomRuleRequest) GetPathPattern() string {
+	if r == nil {
+		return ""
+	}
+	return r.PathPattern
+}
+
+func (r *AddCustomRuleRequest) GetPermissions() Permission {
+	if r == nil {
+		return 0
+	}
+	return r.Permissions
+}
+
+func (r *AddCustomRuleRequest) GetOutcome() string {
+	if r == nil {
+		return ""
+	}
+	return r.Outcome
+}
+
+func (r *AddCustomRuleRequest) GetLifespan() string {
+	if r == nil {
+		return ""
+	}
+	return r.Lifespan
+}
+
+func (r *AddCustomRuleRequest) GetDuration() string {
+	if r == nil {
+		return ""
+	}
+	return r.Duration
+}
+
+type addRulePayload struct {
+	Action      string           `json:"action"`
+	Snap        string           `json:"snap"`
+	Interface   string           `json:"interface"`
+	Constraints snapdConstraints `json:"constraints"`
+	Outcome     string           `json:"outcome"`
+	Lifespan    string           `json:"lifespan"`
+	Duration    string           `json:"duration,omitempty"`
+}
+
+// Rule is the gRPC-facing view of a snapd prompting rule.
+type Rule struct {
+	Id          string
+	Timestamp   string
+	User        int64
+	Snap        string
+	Interface   string
+	PathPattern string
+	Permissions Permission
+	Outcome     string
+	Lifespan    string
+	Expiration  string
+}
+
+func (r *Rule) GetId() string {
+	if r == nil {
+		return ""
+	}
+	return r.Id
+}
+
+func ruleFromSnapd(sr snapdRule) *Rule {
+	return &Rule{
+		Id:          sr.ID,
+		Timestamp:   sr.Timestamp,
+		User:        sr.User,
+		Snap:        sr.Snap,
+		Interface:   sr.Interface,
+		PathPattern: sr.Constraints.PathPattern,
+		Permissions: permissionFromStrings(sr.Constraints.Permissions),
+		Outcome:     sr.Outcome,
+		Lifespan:    sr.Lifespan,
+		Expiration:  sr.Expiration,
+	}
+}
+
+// AddCustomRule creates a new apparmor-prompting rule for a snap.
+func (s *PermissionServer) AddCustomRule(ctx context.Context, req *AddCustomRuleRequest) (*Rule, error) {
+	body, err := json.Marshal(addRulePayload{
+		Action:    "add",
+		Snap:      req.GetSnap(),
+		Interface: req.GetInterface(),
+		Constraints: snapdConstraints{
+			PathPattern: req.GetPathPattern(),
+			Permissions: req.GetPermissions().Strings(),
+		},
+		Outcome:  req.GetOutcome(),
+		Lifespan: req.GetLifespan(),
+		Duration: req.GetDuration(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.do(ctx, http.MethodPost, "/v2/interfaces/requests/rules", body)
+	if err != nil {
+		return nil, err
+	}
+
+	var rule snapdRule
+	if err := json.Unmarshal(result, &rule); err != nil {
+		return nil, err
+	}
+	return ruleFromSnapd(rule), nil
+}
+
+// PatchCustomRuleRequest carries the fields to change on an existing
+// rule; zero-value fields are left untouched by snapd.
+type PatchCustomRuleRequest struct {
+	Id          string
+	PathPattern string
+	Permissions Permission
+	Outcome     string
+	Lifespan    string
+	Duration    string
+}
+
+func (r *PatchCustomRuleRequest) GetId() string {
+	if r == nil {
+		return ""
+	}
+	return r.Id
+}
+
+func (r *PatchCustomRuleRequest) GetPathPattern() string {
+	if r == nil {
+		return ""
+	}
+	return r.PathPattern
+}
+
+func (r *PatchCustomRuleRequest) GetPermissions() Permission {
+	if r == nil {
+		return 0
+	}
+	return r.Permissions
+}
+
+func (r *PatchCustomRuleRequest) GetOutcome() string {
+	if r == nil {
+		return ""
+	}
+	return r.Outcome
+}
+
+func (r *PatchCustomRuleRequest) GetLifespan() string {
+	if r == nil {
+		return ""
+	}
+	return r.Lifespan
+}
+
+func (r *PatchCustomRuleRequest) GetDuration() string {
+	if r == nil {
+		return ""
+	}
+	return r.Duration
+}
+
+type patchRulePayload struct {
+	Action      string                `json:"action"`
+	Constraints *patchRuleConstraints `json:"constraints,omitempty"`
+	Outcome     string                `json:"outcome,omitempty"`
+	Lifespan    string                `json:"lifespan,omitempty"`
+	Duration    string                `json:"duration,omitempty"`
+}
+
+type patchRuleConstraints struct {
+	PathPattern string   `json:"path-pattern,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+}
+
+// PatchCustomRule updates an existing rule in place, e.g. to narrow its
+// permissions or shorten its lifespan. Fields left at their zero value
+// are omitted from the request, so snapd leaves them untouched.
+func (s *PermissionServer) PatchCustomRule(ctx context.Context, req *PatchCustomRuleRequest) (*Rule, error) {
+	payload := patchRulePayload{
+		Action:   "patch",
+		Outcome:  req.GetOutcome(),
+		Lifespan: req.GetLifespan(),
+		Duration: req.GetDuration(),
+	}
+	if req.GetPathPattern() != "" || req.GetPermissions() != 0 {
+		payload.Constraints = &patchRuleConstraints{
+			PathPattern: req.GetPathPattern(),
+			Permissions: req.GetPermissions().Strings(),
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.do(ctx, http.MethodPost, "/v2/interfaces/requests/rules/"+req.GetId(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	var rule snapdRule
+	if err := json.Unmarshal(result, &rule); err != nil {
+		return nil, err
+	}
+	return ruleFromSnapd(rule), nil
+}
+
+// RuleIdRequest identifies a single rule by id. It's shared by handlers
+// that only need an id and nothing else, such as RemoveCustomRule and
+// GetRule.
+type RuleIdRequest struct {
+	Id string
+}
+
+func (r *RuleIdRequest) GetId() string {
+	if r == nil {
+		return ""
+	}
+	return r.Id
+}
+
+// RemoveCustomRule deletes a single rule by id.
+func (s *PermissionServer) RemoveCustomRule(ctx context.Context, req *RuleIdRequest) (*emptypb.Empty, error) {
+	if _, err := s.do(ctx, http.MethodDelete, "/v2/interfaces/requests/rules/"+req.GetId(), nil); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// RemoveAllRulesForSnapRequest scopes a bulk removal to one snap and,
+// optionally, one interface of that snap.
+type RemoveAllRulesForSnapRequest struct {
+	Snap      string
+	Interface string
+}
+
+func (r *RemoveAllRulesForSnapRequest) GetSnap() string {
+	if r == nil {
+		return ""
+	}
+	return r.Snap
+}
+
+func (r *RemoveAllRulesForSnapRequest) GetInterface() string {
+	if r == nil {
+		return ""
+	}
+	return r.Interface
+}
+
+type removeRulesPayload struct {
+	Action    string `json:"action"`
+	Snap      string `json:"snap"`
+	Interface string `json:"interface,omitempty"`
+}
+
+// RemoveAllRulesForSnap deletes every rule for a snap, or just the ones
+// for a single interface of that snap when Interface is set.
+func (s *PermissionServer) RemoveAllRulesForSnap(ctx context.Context, req *RemoveAllRulesForSnapRequest) (*emptypb.Empty, error) {
+	body, err := json.Marshal(removeRulesPayload{
+		Action:    "remove",
+		Snap:      req.GetSnap(),
+		Interface: req.GetInterface(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.do(ctx, http.MethodPost, "/v2/interfaces/requests/rules", body); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// GetRule fetches a single rule by id.
+func (s *PermissionServer) GetRule(ctx context.Context, req *RuleIdRequest) (*Rule, error) {
+	result, err := s.do(ctx, http.MethodGet, "/v2/interfaces/requests/rules/"+req.GetId(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rule snapdRule
+	if err := json.Unmarshal(result, &rule); err != nil {
+		return nil, err
+	}
+	return ruleFromSnapd(rule), nil
+}
@@ -29,6 +29,12 @@ const (
 `
     noCustomRulesJson = `
 {"type":"sync","status-code":200,"status":"OK","result":[]}
+`
+    singleRuleJson = `
+{"type":"sync","status-code":200,"status":"OK","result":{"id":"C7JGESQZTWTSS===","timestamp":"2024-05-24T09:21:18.378444585Z","user":1000,"snap":"simple-notepad","interface":"home","constraints":{"path-pattern":"/home/ubuntu/.config/fobar","permissions":["read","write"]},"outcome":"allow","lifespan":"forever","expiration":"0001-01-01T00:00:00Z"}}
+`
+    notEnabledErrorJson = `
+{"type":"error","status-code":400,"status":"Bad Request","result":{"message":"apparmor prompting is not enabled","kind":"interfaces-requests-not-enabled"}}
 `
 )
 
@@ -40,16 +46,42 @@ const (
     AreCustomRulesApplied
     RemoveAppPermission
     ListPersonalFoldersPermissions
+    AddCustomRule
+    PatchCustomRule
+    RemoveCustomRule
+    RemoveAllRulesForSnap
+    GetRule
 )
 
+// requireSnapdErrorKind asserts err is a *SnapdError carrying kind.
+func requireSnapdErrorKind(t *testing.T, err error, kind string) {
+    t.Helper()
+    var snapdErr *SnapdError
+    require.ErrorAs(t, err, &snapdErr)
+    require.Equal(t, kind, snapdErr.Kind)
+}
+
 type ClientMock struct {
     wantError bool
     isEnabled bool
     testedFun Function
+
+    // gotMethod/gotURL/gotBody capture the last request so tests can
+    // assert the server built the right snapd call.
+    gotMethod string
+    gotURL    string
+    gotBody   string
 }
 func (c *ClientMock) Do(req *http.Request) (*http.Response, error) {
+    c.gotMethod = req.Method
+    c.gotURL = req.URL.String()
+    if req.Body != nil {
+        b, _ := io.ReadAll(req.Body)
+        c.gotBody = string(b)
+    }
+
     if c.wantError {
-        return &http.Response{}, fmt.Errorf("Error")
+        return &http.Response{Body: io.NopCloser(strings.NewReader(notEnabledErrorJson))}, nil
     }
 
     switch c.testedFun {
@@ -69,16 +101,16 @@ func (c *ClientMock) Do(req *http.Request) (*http.Response, error) {
     case DisableAppPermissions:
         fallthrough
     case EnableAppPermissions:
-        s, err := io.ReadAll(req.Body)
-        if err != nil {
-            return nil, fmt.Errorf("Error %w", err)
-        }
-        if string(s) == `{"experimental.apparmor-prompting":false}` ||
-           string(s) == `{"experimental.apparmor-prompting":true}` {
+        if c.gotBody == `{"experimental.apparmor-prompting":false}` ||
+           c.gotBody == `{"experimental.apparmor-prompting":true}` {
             return &http.Response{ Body: io.NopCloser(strings.NewReader("{}"))}, nil
         } else {
             return &http.Response{}, fmt.Errorf("Error")
         }
+    case AddCustomRule, PatchCustomRule, GetRule:
+        return &http.Response{Body: io.NopCloser(strings.NewReader(singleRuleJson))}, nil
+    case RemoveCustomRule, RemoveAllRulesForSnap:
+        return &http.Response{Body: io.NopCloser(strings.NewReader("{}"))}, nil
     }
     panic("Not reached")
 }
@@ -116,7 +148,7 @@ func testToggleAppPermissions(t *testing.T, f Function) {
                 _, err = NewPermissionServer(client).DisableAppPermissions(ctx, nil)
             }
             if tc.wantError {
-                require.Error(t, err)
+                requireSnapdErrorKind(t, err, "interfaces-requests-not-enabled")
             } else {
                 require.NoError(t, err)
             }
@@ -162,7 +194,7 @@ func TestIsAppPermissionsEnabled(t *testing.T) {
             }
             r, err := NewPermissionServer(client).IsAppPermissionsEnabled(ctx, nil)
             if tc.wantError {
-                require.Error(t, err)
+                requireSnapdErrorKind(t, err, "interfaces-requests-not-enabled")
             } else {
                 require.NoError(t, err)
                 require.Equal(t, tc.isEnabled, r.GetValue())
@@ -203,7 +235,7 @@ func TestAreCustomRulesApplied(t *testing.T) {
             var err error
             r, err := NewPermissionServer(client).AreCustomRulesApplied(ctx, nil)
             if tc.wantError {
-                require.Error(t, err)
+                requireSnapdErrorKind(t, err, "interfaces-requests-not-enabled")
             } else {
                 require.NoError(t, err)
                 require.Equal(t, tc.isEnabled, r.GetValue())
@@ -239,7 +271,7 @@ func TestListPersonalFoldersPermissions(t *testing.T) {
             var err error
             r, err := NewPermissionServer(client).ListPersonalFoldersPermissions(ctx, nil)
             if tc.wantError {
-                require.Error(t, err)
+                requireSnapdErrorKind(t, err, "interfaces-requests-not-enabled")
             } else {
                 require.NoError(t, err)
                 fmt.Println(r.GetPathsnaps())
@@ -247,3 +279,75 @@ func TestListPersonalFoldersPermissions(t *testing.T) {
         })
     }
 }
+
+func TestAddCustomRule(t *testing.T) {
+    client := &ClientMock{testedFun: AddCustomRule}
+    r, err := NewPermissionServer(client).AddCustomRule(ctx, &AddCustomRuleRequest{
+        Snap:        "simple-notepad",
+        Interface:   "home",
+        PathPattern: "/home/ubuntu/.config/fobar",
+        Permissions: PermRead | PermWrite,
+        Outcome:     "allow",
+        Lifespan:    "forever",
+    })
+    require.NoError(t, err)
+    require.Equal(t, "POST", client.gotMethod)
+    require.Equal(t, "http://localhost/v2/interfaces/requests/rules", client.gotURL)
+    require.JSONEq(t, `{"action":"add","snap":"simple-notepad","interface":"home","constraints":{"path-pattern":"/home/ubuntu/.config/fobar","permissions":["read","write"]},"outcome":"allow","lifespan":"forever"}`, client.gotBody)
+    require.Equal(t, "C7JGESQZTWTSS===", r.GetId())
+}
+
+func TestPatchCustomRule(t *testing.T) {
+    client := &ClientMock{testedFun: PatchCustomRule}
+    r, err := NewPermissionServer(client).PatchCustomRule(ctx, &PatchCustomRuleRequest{
+        Id:          "C7JGESQZTWTSS===",
+        PathPattern: "/home/ubuntu/.config/fobar",
+        Permissions: PermRead,
+        Outcome:     "allow",
+        Lifespan:    "session",
+    })
+    require.NoError(t, err)
+    require.Equal(t, "POST", client.gotMethod)
+    require.Equal(t, "http://localhost/v2/interfaces/requests/rules/C7JGESQZTWTSS===", client.gotURL)
+    require.JSONEq(t, `{"action":"patch","constraints":{"path-pattern":"/home/ubuntu/.config/fobar","permissions":["read"]},"outcome":"allow","lifespan":"session"}`, client.gotBody)
+    require.Equal(t, "C7JGESQZTWTSS===", r.GetId())
+}
+
+func TestPatchCustomRuleLifespanOnly(t *testing.T) {
+    client := &ClientMock{testedFun: PatchCustomRule}
+    _, err := NewPermissionServer(client).PatchCustomRule(ctx, &PatchCustomRuleRequest{
+        Id:       "C7JGESQZTWTSS===",
+        Lifespan: "session",
+    })
+    require.NoError(t, err)
+    require.JSONEq(t, `{"action":"patch","lifespan":"session"}`, client.gotBody)
+}
+
+func TestRemoveCustomRule(t *testing.T) {
+    client := &ClientMock{testedFun: RemoveCustomRule}
+    _, err := NewPermissionServer(client).RemoveCustomRule(ctx, &RuleIdRequest{Id: "C7JGESQZTWTSS==="})
+    require.NoError(t, err)
+    require.Equal(t, "DELETE", client.gotMethod)
+    require.Equal(t, "http://localhost/v2/interfaces/requests/rules/C7JGESQZTWTSS===", client.gotURL)
+}
+
+func TestRemoveAllRulesForSnap(t *testing.T) {
+    client := &ClientMock{testedFun: RemoveAllRulesForSnap}
+    _, err := NewPermissionServer(client).RemoveAllRulesForSnap(ctx, &RemoveAllRulesForSnapRequest{
+        Snap:      "simple-notepad",
+        Interface: "home",
+    })
+    require.NoError(t, err)
+    require.Equal(t, "POST", client.gotMethod)
+    require.Equal(t, "http://localhost/v2/interfaces/requests/rules", client.gotURL)
+    require.JSONEq(t, `{"action":"remove","snap":"simple-notepad","interface":"home"}`, client.gotBody)
+}
+
+func TestGetRule(t *testing.T) {
+    client := &ClientMock{testedFun: GetRule}
+    r, err := NewPermissionServer(client).GetRule(ctx, &RuleIdRequest{Id: "C7JGESQZTWTSS==="})
+    require.NoError(t, err)
+    require.Equal(t, "GET", client.gotMethod)
+    require.Equal(t, "http://localhost/v2/interfaces/requests/rules/C7JGESQZTWTSS===", client.gotURL)
+    require.Equal(t, "C7JGESQZTWTSS===", r.GetId())
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// PermissionService_SubscribePromptsServer is the server-side stream a
+// generated permission.pb.go would hand SubscribePrompts.
+type PermissionService_SubscribePromptsServer interface {
+	grpc.ServerStream
+	Send(*PromptEvent) error
+}
+
+// PromptEvent is one interactive apparmor-prompting request snapd is
+// waiting on a decision for.
+type PromptEvent struct {
+	Id          string
+	Snap        string
+	Interface   string
+	Path        string
+	Permissions Permission
+}
+
+func (p *PromptEvent) GetId() string {
+	if p == nil {
+		return ""
+	}
+	return p.Id
+}
+
+type snapdNotice struct {
+	ID           string `json:"id"`
+	Key          string `json:"key"`
+	Type         string `json:"type"`
+	LastOccurred string `json:"last-occurred"`
+}
+
+type snapdPrompt struct {
+	ID          string `json:"id"`
+	Snap        string `json:"snap"`
+	Interface   string `json:"interface"`
+	Constraints struct {
+		Path        string   `json:"path"`
+		Permissions []string `json:"permissions"`
+	} `json:"constraints"`
+}
+
+// noticesLongPollTimeout is how long a single /v2/notices request is
+// allowed to block waiting for a new prompt before snapd returns
+// whatever (if anything) arrived. Without it snapd answers immediately,
+// turning the "long-poll loop" into a hot spin.
+const noticesLongPollTimeout = "30s"
+
+func (s *PermissionServer) pollPromptNotices(ctx context.Context, after string) ([]snapdNotice, error) {
+	path := "/v2/notices?types=interfaces-requests-prompt&timeout=" + noticesLongPollTimeout
+	if after != "" {
+		path += "&after=" + url.QueryEscape(after)
+	}
+	result, err := s.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var notices []snapdNotice
+	if err := json.Unmarshal(result, &notices); err != nil {
+		return nil, err
+	}
+	return notices, nil
+}
+
+func (s *PermissionServer) fetchPrompt(ctx context.Context, id string) (*PromptEvent, error) {
+	result, err := s.do(ctx, http.MethodGet, "/v2/interfaces/requests/prompts/"+id, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var prompt snapdPrompt
+	if err := json.Unmarshal(result, &prompt); err != nil {
+		return nil, err
+	}
+	return &PromptEvent{
+		Id:          prompt.ID,
+		Snap:        prompt.Snap,
+		Interface:   prompt.Interface,
+		Path:        prompt.Constraints.Path,
+		Permissions: permissionFromStrings(prompt.Constraints.Permissions),
+	}, nil
+}
+
+// SubscribePrompts long-polls snapd's notices endpoint for
+// interfaces-requests-prompt notices, fetches the full prompt for each
+// one, and streams a PromptEvent per prompt until the client
+// disconnects or snapd returns an error.
+func (s *PermissionServer) SubscribePrompts(_ *emptypb.Empty, stream PermissionService_SubscribePromptsServer) error {
+	after := ""
+	for {
+		notices, err := s.pollPromptNotices(stream.Context(), after)
+		if err != nil {
+			return err
+		}
+
+		for _, notice := range notices {
+			after = notice.LastOccurred
+			event, err := s.fetchPrompt(stream.Context(), notice.Key)
+			if err != nil {
+				return err
+			}
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ReplyPromptRequest answers a single outstanding prompt.
+type ReplyPromptRequest struct {
+	Id          string
+	Outcome     string
+	Lifespan    string
+	PathPattern string
+	Permissions Permission
+}
+
+func (r *ReplyPromptRequest) GetId() string {
+	if r == nil {
+		return ""
+	}
+	return r.Id
+}
+
+func (r *ReplyPromptRequest) GetOutcome() string {
+	if r == nil {
+		return ""
+	}
+	return r.Outcome
+}
+
+func (r *ReplyPromptRequest) GetLifespan() string {
+	if r == nil {
+		return ""
+	}
+	return r.Lifespan
+}
+
+func (r *ReplyPromptRequest) GetPathPattern() string {
+	if r == nil {
+		return ""
+	}
+	return r.PathPattern
+}
+
+func (r *ReplyPromptRequest) GetPermissions() Permission {
+	if r == nil {
+		return 0
+	}
+	return r.Permissions
+}
+
+type replyPromptPayload struct {
+	Outcome     string                  `json:"outcome"`
+	Lifespan    string                  `json:"lifespan"`
+	Constraints *replyPromptConstraints `json:"constraints,omitempty"`
+}
+
+type replyPromptConstraints struct {
+	PathPattern string   `json:"path-pattern"`
+	Permissions []string `json:"permissions"`
+}
+
+// ReplyPrompt answers an outstanding prompt with an outcome (allow/deny),
+// a lifespan, and the constraints the reply should be remembered under.
+func (s *PermissionServer) ReplyPrompt(ctx context.Context, req *ReplyPromptRequest) (*emptypb.Empty, error) {
+	payload := replyPromptPayload{
+		Outcome:  req.GetOutcome(),
+		Lifespan: req.GetLifespan(),
+	}
+	if req.GetPathPattern() != "" || req.GetPermissions() != 0 {
+		payload.Constraints = &replyPromptConstraints{
+			PathPattern: req.GetPathPattern(),
+			Permissions: req.GetPermissions().Strings(),
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.do(ctx, http.MethodPost, "/v2/interfaces/requests/prompts/"+req.GetId(), body); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSubscribeStream is a minimal PermissionService_SubscribePromptsServer
+// double: it embeds the PermissionService_SubscribePromptsServer
+// interface so it only needs to implement the two methods
+// SubscribePrompts actually calls.
+type fakeSubscribeStream struct {
+	PermissionService_SubscribePromptsServer
+	ctx    context.Context
+	events []*PromptEvent
+}
+
+func (f *fakeSubscribeStream) Context() context.Context {
+	return f.ctx
+}
+
+func (f *fakeSubscribeStream) Send(e *PromptEvent) error {
+	f.events = append(f.events, e)
+	return nil
+}
+
+var errNoMoreNotices = fmt.Errorf("no more notices")
+
+// promptsClientMock synthesizes a fixed sequence of snapd responses: one
+// batch of notices, one prompt detail fetch per notice, and then an
+// error on the next long-poll so the test can observe the stream ending.
+type promptsClientMock struct {
+	notices     string
+	prompts     map[string]string
+	noticeCalls int
+}
+
+func (c *promptsClientMock) Do(req *http.Request) (*http.Response, error) {
+	switch {
+	case strings.Contains(req.URL.Path, "/v2/notices"):
+		c.noticeCalls++
+		if c.noticeCalls > 1 {
+			return &http.Response{}, errNoMoreNotices
+		}
+		return &http.Response{Body: io.NopCloser(strings.NewReader(c.notices))}, nil
+	case strings.Contains(req.URL.Path, "/v2/interfaces/requests/prompts/"):
+		id := strings.TrimPrefix(req.URL.Path, "/v2/interfaces/requests/prompts/")
+		return &http.Response{Body: io.NopCloser(strings.NewReader(c.prompts[id]))}, nil
+	}
+	panic("Not reached")
+}
+
+func TestSubscribePrompts(t *testing.T) {
+	client := &promptsClientMock{
+		notices: `
+{"type":"sync","status-code":200,"status":"OK","result":[
+  {"id":"1","key":"prompt-1","type":"interfaces-requests-prompt","last-occurred":"2024-05-24T09:21:18.378444585Z"},
+  {"id":"2","key":"prompt-2","type":"interfaces-requests-prompt","last-occurred":"2024-05-24T09:21:19.378444585Z"}
+]}
+`,
+		prompts: map[string]string{
+			"prompt-1": `{"type":"sync","status-code":200,"status":"OK","result":{"id":"prompt-1","snap":"simple-notepad","interface":"home","constraints":{"path":"/home/ubuntu/.config/fobar","permissions":["read"]}}}`,
+			"prompt-2": `{"type":"sync","status-code":200,"status":"OK","result":{"id":"prompt-2","snap":"simple-notepad","interface":"home","constraints":{"path":"/home/ubuntu/Documents/fobar","permissions":["read","write"]}}}`,
+		},
+	}
+	stream := &fakeSubscribeStream{ctx: ctx}
+
+	err := NewPermissionServer(client).SubscribePrompts(nil, stream)
+	require.ErrorIs(t, err, errNoMoreNotices)
+	require.Len(t, stream.events, 2)
+	require.Equal(t, "prompt-1", stream.events[0].GetId())
+	require.Equal(t, "prompt-2", stream.events[1].GetId())
+}
+
+func TestReplyPrompt(t *testing.T) {
+	client := &ClientMock{testedFun: RemoveCustomRule}
+	_, err := NewPermissionServer(client).ReplyPrompt(ctx, &ReplyPromptRequest{
+		Id:          "prompt-1",
+		Outcome:     "allow",
+		Lifespan:    "session",
+		PathPattern: "/home/ubuntu/.config/fobar",
+		Permissions: PermRead,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "POST", client.gotMethod)
+	require.Equal(t, "http://localhost/v2/interfaces/requests/prompts/prompt-1", client.gotURL)
+	require.JSONEq(t, `{"outcome":"allow","lifespan":"session","constraints":{"path-pattern":"/home/ubuntu/.config/fobar","permissions":["read"]}}`, client.gotBody)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// SnapdTransport is the pluggable HTTP surface PermissionServer talks to
+// snapd through. Swapping implementations lets the daemon dial the
+// default Unix socket, a remote snapd over TCP for development, or (in
+// tests) an in-memory double, and lets decorators like WithRetry and
+// WithAuth wrap any of them.
+type SnapdTransport interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// defaultSnapdSocket is where snapd listens on every stock Ubuntu/snapd
+// install.
+const defaultSnapdSocket = "/run/snapd.socket"
+
+// NewUnixSocketTransport dials snapd's Unix-domain socket at socketPath.
+// An empty socketPath falls back to defaultSnapdSocket.
+func NewUnixSocketTransport(socketPath string) SnapdTransport {
+	if socketPath == "" {
+		socketPath = defaultSnapdSocket
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socketPath)
+			},
+		},
+	}
+}
+
+// NewTCPTransport dials a remote or development snapd listening on addr
+// (e.g. "localhost:8080") instead of the default Unix socket.
+func NewTCPTransport(addr string) SnapdTransport {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			},
+		},
+	}
+}
+
+// WithRetry wraps next so requests are retried, with exponential
+// backoff, on a 5xx response or a connection-refused error (snapd
+// restarting). maxAttempts includes the initial try.
+func WithRetry(next SnapdTransport, maxAttempts int) SnapdTransport {
+	return &retryTransport{next: next, maxAttempts: maxAttempts}
+}
+
+type retryTransport struct {
+	next        SnapdTransport
+	maxAttempts int
+}
+
+func (t *retryTransport) Do(req *http.Request) (*http.Response, error) {
+	backoff := 100 * time.Millisecond
+	var lastResp *http.Response
+	var lastErr error
+	for attempt := 0; attempt < t.maxAttempts; attempt++ {
+		if attempt > 0 {
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				req.Body = body
+			}
+			select {
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		resp, err := t.next.Do(req)
+		if err != nil {
+			if !isRetryableError(err) {
+				if lastResp != nil {
+					lastResp.Body.Close()
+				}
+				return nil, err
+			}
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode < 500 {
+			if lastResp != nil {
+				lastResp.Body.Close()
+			}
+			return resp, nil
+		}
+
+		// Keep this response around in case every retry is exhausted,
+		// so the caller still gets snapd's own (possibly structured)
+		// error body instead of a synthesized one. Its body is closed
+		// once it's superseded by a later attempt, success or not.
+		if lastResp != nil {
+			lastResp.Body.Close()
+		}
+		lastResp = resp
+		lastErr = nil
+	}
+	if lastResp != nil {
+		return lastResp, nil
+	}
+	return nil, lastErr
+}
+
+func isRetryableError(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// WithAuth wraps next so every request carries the headers snapd
+// expects for privileged writes: X-Allow-Interaction, so polkit can
+// prompt the user interactively, and, when macaroon is non-empty, a
+// macaroon Authorization header identifying the session the daemon is
+// running under.
+func WithAuth(next SnapdTransport, macaroon string, discharges []string) SnapdTransport {
+	return &authTransport{next: next, macaroon: macaroon, discharges: discharges}
+}
+
+type authTransport struct {
+	next       SnapdTransport
+	macaroon   string
+	discharges []string
+}
+
+func (t *authTransport) Do(req *http.Request) (*http.Response, error) {
+	req.Header.Set("X-Allow-Interaction", "true")
+	if t.macaroon != "" {
+		req.Header.Set("Authorization", macaroonAuthHeader(t.macaroon, t.discharges))
+	}
+	return t.next.Do(req)
+}
+
+func macaroonAuthHeader(macaroon string, discharges []string) string {
+	header := fmt.Sprintf(`Macaroon root="%s"`, macaroon)
+	for _, discharge := range discharges {
+		header += fmt.Sprintf(`, discharge="%s"`, discharge)
+	}
+	return header
+}
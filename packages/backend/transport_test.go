@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type sequenceTransport struct {
+	responses []*http.Response
+	errs      []error
+	calls     int
+}
+
+func (t *sequenceTransport) Do(req *http.Request) (*http.Response, error) {
+	i := t.calls
+	t.calls++
+	if i < len(t.errs) && t.errs[i] != nil {
+		return nil, t.errs[i]
+	}
+	return t.responses[i], nil
+}
+
+// closeTrackingBody wraps a Reader so tests can assert a response body
+// was actually closed, which io.NopCloser can't do.
+type closeTrackingBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *closeTrackingBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestWithRetryRetriesOn5xx(t *testing.T) {
+	discarded := &closeTrackingBody{Reader: strings.NewReader("")}
+	next := &sequenceTransport{
+		responses: []*http.Response{
+			{StatusCode: 503, Body: discarded},
+			{StatusCode: 200, Body: io.NopCloser(strings.NewReader("{}"))},
+		},
+		errs: make([]error, 2),
+	}
+	transport := WithRetry(next, 3)
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, snapdBaseURL+"/v2/system-info", nil)
+	require.NoError(t, err)
+
+	resp, err := transport.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	require.Equal(t, 2, next.calls)
+	require.True(t, discarded.closed, "body of the superseded 503 response must be closed")
+}
+
+func TestWithRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	errBody := `{"type":"error","status-code":503,"status":"Service Unavailable","result":{"message":"snapd is restarting","kind":"interfaces-requests-not-enabled"}}`
+	next := &sequenceTransport{
+		responses: []*http.Response{
+			{StatusCode: 503, Body: io.NopCloser(strings.NewReader(errBody))},
+			{StatusCode: 503, Body: io.NopCloser(strings.NewReader(errBody))},
+		},
+		errs: make([]error, 2),
+	}
+	transport := WithRetry(next, 2)
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, snapdBaseURL+"/v2/system-info", nil)
+	require.NoError(t, err)
+
+	// Exhausting every retry still returns snapd's last response rather
+	// than a synthesized error, so do()'s envelope decoding can turn it
+	// into a *SnapdError.
+	resp, err := transport.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, 503, resp.StatusCode)
+	require.Equal(t, 2, next.calls)
+}
+
+func TestPermissionServerSurfacesSnapdErrorAfterExhaustedRetries(t *testing.T) {
+	errBody := `{"type":"error","status-code":503,"status":"Service Unavailable","result":{"message":"snapd is restarting","kind":"interfaces-requests-not-enabled"}}`
+	next := &sequenceTransport{
+		responses: []*http.Response{
+			{StatusCode: 503, Body: io.NopCloser(strings.NewReader(errBody))},
+			{StatusCode: 503, Body: io.NopCloser(strings.NewReader(errBody))},
+		},
+		errs: make([]error, 2),
+	}
+	transport := WithRetry(next, 2)
+
+	_, err := NewPermissionServer(transport).IsAppPermissionsEnabled(context.Background(), nil)
+	requireSnapdErrorKind(t, err, "interfaces-requests-not-enabled")
+}
+
+func TestWithAuthSetsHeaders(t *testing.T) {
+	next := &sequenceTransport{
+		responses: []*http.Response{{StatusCode: 200, Body: io.NopCloser(strings.NewReader("{}"))}},
+		errs:      make([]error, 1),
+	}
+	transport := WithAuth(next, "root-macaroon", []string{"discharge-1"})
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, snapdBaseURL+"/v2/interfaces/requests/rules", nil)
+	require.NoError(t, err)
+
+	_, err = transport.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, "true", req.Header.Get("X-Allow-Interaction"))
+	require.Equal(t, `Macaroon root="root-macaroon", discharge="discharge-1"`, req.Header.Get("Authorization"))
+}
+
+func TestPermissionServerHonorsCanceledContext(t *testing.T) {
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	client := &ClientMock{testedFun: IsAppPermissionsEnabled, isEnabled: true}
+	_, err := NewPermissionServer(client).IsAppPermissionsEnabled(canceledCtx, nil)
+	require.Error(t, err)
+}